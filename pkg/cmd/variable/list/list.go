@@ -3,9 +3,14 @@ package list
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/MakeNowJust/heredoc"
@@ -18,17 +23,52 @@ import (
 	"github.com/cli/cli/v2/pkg/cmdutil"
 	"github.com/cli/cli/v2/pkg/iostreams"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 )
 
+// pageFetchConcurrency bounds how many variable list pages, or selected-repo
+// lookups, are requested from the API at once.
+const pageFetchConcurrency = 5
+
+// variablesPerPage is the page size requested from the variables list
+// endpoints; it's used to work out how many pages are actually needed to
+// satisfy a --limit without over-fetching.
+const variablesPerPage = 100
+
 type ListOptions struct {
 	HttpClient func() (*http.Client, error)
 	IO         *iostreams.IOStreams
 	Config     func() (config.Config, error)
 	BaseRepo   func() (ghrepo.Interface, error)
 
-	OrgName     string
-	EnvName     string
-	Application string
+	Exporter cmdutil.Exporter
+
+	OrgName           string
+	EnvName           string
+	Application       string
+	Limit             int
+	ShowSelectedRepos bool
+	Resolve           bool
+}
+
+// maxResolveIterations bounds how deep a chain of ${{ vars.X }} references
+// resolveValue will follow before giving up.
+const maxResolveIterations = 10
+
+// maxResolvedValueLen caps the length a value may grow to while resolving
+// references, guarding against billion-laughs style expansion.
+const maxResolvedValueLen = 64 * 1024
+
+var varRefRE = regexp.MustCompile(`\$\{\{\s*vars\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+var variableFields = []string{
+	"name",
+	"value",
+	"updatedAt",
+	"visibility",
+	"numSelectedRepos",
+	"selectedRepositoriesUrl",
+	"selectedRepositories",
 }
 
 func NewCmdList(f *cmdutil.Factory, runF func(*ListOptions) error) *cobra.Command {
@@ -57,6 +97,14 @@ func NewCmdList(f *cmdutil.Factory, runF func(*ListOptions) error) *cobra.Comman
 				return err
 			}
 
+			if opts.Limit < 0 {
+				return cmdutil.FlagErrorf("invalid limit: %v", opts.Limit)
+			}
+
+			if opts.ShowSelectedRepos && opts.OrgName == "" {
+				return cmdutil.FlagErrorf("`--show-selected-repos` is only supported with `--org`")
+			}
+
 			if runF != nil {
 				return runF(opts)
 			}
@@ -67,6 +115,10 @@ func NewCmdList(f *cmdutil.Factory, runF func(*ListOptions) error) *cobra.Comman
 
 	cmd.Flags().StringVarP(&opts.OrgName, "org", "o", "", "List variables for an organization")
 	cmd.Flags().StringVarP(&opts.EnvName, "env", "e", "", "List variables for an environment")
+	cmd.Flags().IntVarP(&opts.Limit, "limit", "L", 0, "Maximum number of variables to list (default: no limit)")
+	cmd.Flags().BoolVar(&opts.ShowSelectedRepos, "show-selected-repos", false, "Expand `selected` visibility org variables into the names of the repositories that can access them")
+	cmd.Flags().BoolVar(&opts.Resolve, "resolve", false, "Resolve `${{ vars.NAME }}` references between variable values before printing")
+	cmdutil.AddJSONFlags(cmd, &opts.Exporter, variableFields)
 
 	return cmd
 }
@@ -94,13 +146,13 @@ func listRun(opts *ListOptions) error {
 	}
 
 	var variables []*Variable
-	showSelectedRepoInfo := opts.IO.IsStdoutTTY()
+	showSelectedRepoInfo := opts.IO.IsStdoutTTY() || opts.Exporter != nil
 
 	switch variableEntity {
 	case shared.Repository:
-		variables, err = getRepoVariables(client, baseRepo)
+		variables, err = getRepoVariables(client, baseRepo, opts.Limit)
 	case shared.Environment:
-		variables, err = getEnvVariables(client, baseRepo, envName)
+		variables, err = getEnvVariables(client, baseRepo, envName, opts.Limit)
 	case shared.Organization:
 		var cfg config.Config
 		var host string
@@ -112,17 +164,25 @@ func listRun(opts *ListOptions) error {
 
 		host, _ = cfg.Authentication().DefaultHost()
 
-		variables, err = getOrgVariables(client, host, orgName, showSelectedRepoInfo)
+		variables, err = getOrgVariables(client, host, orgName, opts.Limit, showSelectedRepoInfo, opts.ShowSelectedRepos)
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to get variables: %w", err)
 	}
 
-	if len(variables) == 0 {
+	if opts.Resolve {
+		resolveVariableValues(opts.IO.ErrOut, variables)
+	}
+
+	if len(variables) == 0 && opts.Exporter == nil {
 		return cmdutil.NewNoResultsError("no variables found")
 	}
 
+	if opts.Exporter != nil {
+		return opts.Exporter.Write(opts.IO, variables)
+	}
+
 	if err := opts.IO.StartPager(); err == nil {
 		defer opts.IO.StopPager()
 	} else {
@@ -131,7 +191,11 @@ func listRun(opts *ListOptions) error {
 
 	table := tableprinter.New(opts.IO)
 	if opts.OrgName != "" {
-		table.HeaderRow("NAME", "VALUE", "UPDATED AT", "VISIBILITY")
+		if opts.ShowSelectedRepos {
+			table.HeaderRow("NAME", "VALUE", "UPDATED AT", "VISIBILITY", "SELECTED REPOS")
+		} else {
+			table.HeaderRow("NAME", "VALUE", "UPDATED AT", "VISIBILITY")
+		}
 	} else {
 		table.HeaderRow("NAME", "VALUE", "UPDATED AT")
 	}
@@ -150,6 +214,9 @@ func listRun(opts *ListOptions) error {
 				table.AddField(strings.ToUpper(string(variable.Visibility)), nil, nil)
 			}
 		}
+		if opts.ShowSelectedRepos {
+			table.AddField(strings.Join(variable.SelectedRepositories, ", "))
+		}
 		table.EndRow()
 	}
 
@@ -162,12 +229,38 @@ func listRun(opts *ListOptions) error {
 }
 
 type Variable struct {
-	Name             string
-	Value            string
-	UpdatedAt        time.Time `json:"updated_at"`
-	Visibility       shared.Visibility
-	SelectedReposURL string `json:"selected_repositories_url"`
-	NumSelectedRepos int
+	Name                 string
+	Value                string
+	UpdatedAt            time.Time `json:"updated_at"`
+	Visibility           shared.Visibility
+	SelectedReposURL     string `json:"selected_repositories_url"`
+	NumSelectedRepos     int
+	SelectedRepositories []string
+}
+
+func (v *Variable) ExportData(fields []string) map[string]interface{} {
+	data := map[string]interface{}{}
+
+	for _, field := range fields {
+		switch field {
+		case "name":
+			data["name"] = v.Name
+		case "value":
+			data["value"] = v.Value
+		case "updatedAt":
+			data["updatedAt"] = v.UpdatedAt
+		case "visibility":
+			data["visibility"] = v.Visibility
+		case "numSelectedRepos":
+			data["numSelectedRepos"] = v.NumSelectedRepos
+		case "selectedRepositoriesUrl":
+			data["selectedRepositoriesUrl"] = v.SelectedReposURL
+		case "selectedRepositories":
+			data["selectedRepositories"] = v.SelectedRepositories
+		}
+	}
+
+	return data
 }
 
 func fmtVisibility(s Variable) string {
@@ -186,29 +279,40 @@ func fmtVisibility(s Variable) string {
 	return ""
 }
 
-func getOrgVariables(client httpClient, host, orgName string, showSelectedRepoInfo bool) ([]*Variable, error) {
-	variables, err := getVariables(client, host, fmt.Sprintf("orgs/%s/actions/variables", orgName))
+func getOrgVariables(client httpClient, host, orgName string, limit int, showSelectedRepoInfo, showSelectedRepoNames bool) ([]*Variable, error) {
+	variables, err := getVariables(client, host, fmt.Sprintf("orgs/%s/actions/variables", orgName), limit)
 	if err != nil {
 		return nil, err
 	}
 
-	if showSelectedRepoInfo {
-		err = getSelectedRepositoryInformation(client, variables)
-		if err != nil {
+	switch {
+	case showSelectedRepoNames:
+		// Fetching the full repository list also tells us the count, so
+		// there's no need to hit SelectedReposURL a second time just for
+		// total_count.
+		if err := getSelectedRepositoryNames(client, variables); err != nil {
+			return nil, err
+		}
+		for _, variable := range variables {
+			variable.NumSelectedRepos = len(variable.SelectedRepositories)
+		}
+	case showSelectedRepoInfo:
+		if err := getSelectedRepositoryInformation(client, variables); err != nil {
 			return nil, err
 		}
 	}
+
 	return variables, nil
 }
 
-func getEnvVariables(client httpClient, repo ghrepo.Interface, envName string) ([]*Variable, error) {
+func getEnvVariables(client httpClient, repo ghrepo.Interface, envName string, limit int) ([]*Variable, error) {
 	path := fmt.Sprintf("repositories/%s/environments/%s/variables", ghrepo.FullName(repo), envName)
-	return getVariables(client, repo.RepoHost(), path)
+	return getVariables(client, repo.RepoHost(), path, limit)
 }
 
-func getRepoVariables(client httpClient, repo ghrepo.Interface) ([]*Variable, error) {
+func getRepoVariables(client httpClient, repo ghrepo.Interface, limit int) ([]*Variable, error) {
 	return getVariables(client, repo.RepoHost(), fmt.Sprintf("repos/%s/actions/variables",
-		ghrepo.FullName(repo)))
+		ghrepo.FullName(repo)), limit)
 }
 
 type variablesPayload struct {
@@ -219,27 +323,103 @@ type httpClient interface {
 	Do(*http.Request) (*http.Response, error)
 }
 
-func getVariables(client httpClient, host, path string) ([]*Variable, error) {
-	var results []*Variable
-	url := fmt.Sprintf("%s%s?per_page=100", ghinstance.RESTPrefix(host), path)
+// getVariables fetches the first page on its own so it can learn, from the
+// response's Link header, how many pages remain. Any remaining pages are
+// then requested concurrently, bounded by pageFetchConcurrency, instead of
+// walking the "next" links one at a time. If limit is positive, fetching
+// stops as soon as enough variables have been collected.
+func getVariables(client httpClient, host, path string, limit int) ([]*Variable, error) {
+	firstURL := fmt.Sprintf("%s%s?per_page=%d", ghinstance.RESTPrefix(host), path, variablesPerPage)
 
-	for {
-		var payload variablesPayload
-		nextURL, err := apiGet(client, url, &payload)
-		if err != nil {
-			return nil, err
+	var firstPage variablesPayload
+	link, err := apiGet(client, firstURL, &firstPage)
+	if err != nil {
+		return nil, err
+	}
+
+	results := firstPage.Variables
+	if limit > 0 && len(results) >= limit {
+		return results[:limit], nil
+	}
+
+	lastPage := findLastPage(link)
+	if lastPage < 2 {
+		return results, nil
+	}
+
+	// Don't fan out further than the number of pages needed to satisfy
+	// limit; each of pages 1..lastPage-1 is full, so ceil(limit/perPage)
+	// pages is always enough.
+	upToPage := lastPage
+	if limit > 0 {
+		neededPages := (limit + variablesPerPage - 1) / variablesPerPage
+		if neededPages < upToPage {
+			upToPage = neededPages
 		}
-		results = append(results, payload.Variables...)
+	}
+	if upToPage < 2 {
+		return results, nil
+	}
+
+	pages := make([][]*Variable, upToPage+1)
+	pages[1] = results
+
+	g := new(errgroup.Group)
+	sem := make(chan struct{}, pageFetchConcurrency)
+	var mu sync.Mutex
+
+	for page := 2; page <= upToPage; page++ {
+		page := page
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			pageURL, err := setPageParam(firstURL, page)
+			if err != nil {
+				return err
+			}
 
-		if nextURL == "" {
-			break
+			var payload variablesPayload
+			if _, err := apiGet(client, pageURL, &payload); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			pages[page] = payload.Variables
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	results = nil
+	for _, page := range pages[1:] {
+		results = append(results, page...)
+		if limit > 0 && len(results) >= limit {
+			return results[:limit], nil
 		}
-		url = nextURL
 	}
 
 	return results, nil
 }
 
+func setPageParam(rawURL string, page int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// apiGet decodes the response body into data and returns the raw Link
+// response header, unparsed, so callers can pull whichever rel they need
+// (findNextPage, findLastPage) out of it.
 func apiGet(client httpClient, url string, data interface{}) (string, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -262,7 +442,7 @@ func apiGet(client httpClient, url string, data interface{}) (string, error) {
 		return "", err
 	}
 
-	return findNextPage(resp.Header.Get("Link")), nil
+	return resp.Header.Get("Link"), nil
 }
 
 var linkRE = regexp.MustCompile(`<([^>]+)>;\s*rel="([^"]+)"`)
@@ -276,21 +456,201 @@ func findNextPage(link string) string {
 	return ""
 }
 
+// findLastPage returns the page number of the "last" rel in a Link header,
+// or 1 if the header has no "last" link with a numeric page parameter. The
+// "next" rel is not consulted.
+func findLastPage(link string) int {
+	for _, m := range linkRE.FindAllStringSubmatch(link, -1) {
+		if len(m) <= 2 || m[2] != "last" {
+			continue
+		}
+		u, err := url.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		if page, err := strconv.Atoi(u.Query().Get("page")); err == nil {
+			return page
+		}
+	}
+	return 1
+}
+
 func getSelectedRepositoryInformation(client httpClient, variables []*Variable) error {
 	type responseData struct {
 		TotalCount int `json:"total_count"`
 	}
 
+	g := new(errgroup.Group)
+	sem := make(chan struct{}, pageFetchConcurrency)
+
 	for _, variable := range variables {
+		variable := variable
 		if variable.SelectedReposURL == "" {
 			continue
 		}
-		var result responseData
-		if _, err := apiGet(client, variable.SelectedReposURL, &result); err != nil {
-			return fmt.Errorf("failed determining selected repositories for %s: %w", variable.Name, err)
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var result responseData
+			if _, err := apiGet(client, variable.SelectedReposURL, &result); err != nil {
+				return fmt.Errorf("failed determining selected repositories for %s: %w", variable.Name, err)
+			}
+			variable.NumSelectedRepos = result.TotalCount
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// getSelectedRepositoryNames resolves, for each selected-visibility variable,
+// the full list of repository names behind its SelectedReposURL. It walks
+// that endpoint's own pagination, since the number of selected repos can
+// itself exceed one page.
+func getSelectedRepositoryNames(client httpClient, variables []*Variable) error {
+	type repository struct {
+		FullName string `json:"full_name"`
+	}
+	type responseData struct {
+		Repositories []repository `json:"repositories"`
+	}
+
+	g := new(errgroup.Group)
+	sem := make(chan struct{}, pageFetchConcurrency)
+
+	for _, variable := range variables {
+		variable := variable
+		if variable.SelectedReposURL == "" {
+			continue
 		}
-		variable.NumSelectedRepos = result.TotalCount
+		g.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var names []string
+			url := fmt.Sprintf("%s?per_page=100", variable.SelectedReposURL)
+			for url != "" {
+				var result responseData
+				link, err := apiGet(client, url, &result)
+				if err != nil {
+					return fmt.Errorf("failed listing selected repositories for %s: %w", variable.Name, err)
+				}
+				for _, repo := range result.Repositories {
+					names = append(names, repo.FullName)
+				}
+				url = findNextPage(link)
+			}
+			variable.SelectedRepositories = names
+			return nil
+		})
 	}
 
-	return nil
+	return g.Wait()
+}
+
+// resolveVariableValues rewrites each variable's Value in place, substituting
+// any ${{ vars.OTHER_NAME }} references with the value of the named variable
+// from the same fetch. References to names that weren't fetched are left
+// literal and reported to errOut, while the value's other references are
+// still substituted. A value whose resolution fails (a cycle, a chain that
+// is too deep, or an oversized result) is reported to errOut and left as-is.
+func resolveVariableValues(errOut io.Writer, variables []*Variable) {
+	values := make(map[string]string, len(variables))
+	for _, v := range variables {
+		values[v.Name] = v.Value
+	}
+
+	for _, v := range variables {
+		resolved, unresolved, err := resolveValue(v.Name, values)
+		if err != nil {
+			fmt.Fprintf(errOut, "warning: could not resolve %q: %v\n", v.Name, err)
+			continue
+		}
+		if len(unresolved) > 0 {
+			fmt.Fprintf(errOut, "warning: %q references undefined variable(s): %s\n", v.Name, strings.Join(unresolved, ", "))
+		}
+		v.Value = resolved
+	}
+}
+
+// resolveValue substitutes ${{ vars.X }} tokens in the named variable's
+// value, recursively resolving each reference and memoizing the result so
+// a variable referenced from more than one place (a "diamond": A refers to
+// both B and C, and C also refers to B) is only resolved once rather than
+// being mistaken for a cycle. A cycle is only reported when a name reappears
+// among its own ancestors on the current resolution path. References to
+// names outside of values are returned unresolved rather than treated as an
+// error.
+func resolveValue(startName string, values map[string]string) (resolved string, unresolved []string, err error) {
+	memo := map[string]string{}
+	unresolvedSet := map[string]struct{}{}
+
+	resolved, err = resolveValueRec(startName, values, memo, map[string]struct{}{}, unresolvedSet, 0)
+	if err != nil {
+		return values[startName], nil, err
+	}
+
+	for name := range unresolvedSet {
+		unresolved = append(unresolved, name)
+	}
+	sort.Strings(unresolved)
+
+	return resolved, unresolved, nil
+}
+
+// resolveValueRec resolves name's value, substituting any ${{ vars.X }}
+// tokens it contains. path holds the ancestors currently being resolved on
+// this call stack; a reference back into path is a genuine cycle, whereas a
+// reference to a name that was already fully resolved via a different
+// branch is served from memo instead of being re-walked.
+func resolveValueRec(name string, values map[string]string, memo map[string]string, path map[string]struct{}, unresolved map[string]struct{}, depth int) (string, error) {
+	if v, ok := memo[name]; ok {
+		return v, nil
+	}
+	if depth > maxResolveIterations {
+		return "", fmt.Errorf("reference chain for %q is too deep (max %d)", name, maxResolveIterations)
+	}
+
+	childPath := make(map[string]struct{}, len(path)+1)
+	for p := range path {
+		childPath[p] = struct{}{}
+	}
+	childPath[name] = struct{}{}
+
+	var substErr error
+	out := varRefRE.ReplaceAllStringFunc(values[name], func(token string) string {
+		if substErr != nil {
+			return token
+		}
+
+		ref := varRefRE.FindStringSubmatch(token)[1]
+
+		if _, ok := values[ref]; !ok {
+			unresolved[ref] = struct{}{}
+			return token
+		}
+
+		if _, inPath := childPath[ref]; inPath {
+			substErr = fmt.Errorf("cycle detected: %q is referenced again while resolving %q", ref, name)
+			return token
+		}
+
+		refValue, err := resolveValueRec(ref, values, memo, childPath, unresolved, depth+1)
+		if err != nil {
+			substErr = err
+			return token
+		}
+		return refValue
+	})
+	if substErr != nil {
+		return "", substErr
+	}
+
+	if len(out) > maxResolvedValueLen {
+		return "", fmt.Errorf("resolved value for %q exceeds %d bytes", name, maxResolvedValueLen)
+	}
+
+	memo[name] = out
+	return out, nil
 }
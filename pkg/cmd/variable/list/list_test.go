@@ -0,0 +1,315 @@
+package list
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cli/cli/v2/internal/config"
+	"github.com/cli/cli/v2/internal/ghrepo"
+	"github.com/cli/cli/v2/pkg/cmd/variable/shared"
+	"github.com/cli/cli/v2/pkg/cmdutil"
+	"github.com/cli/cli/v2/pkg/iostreams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagedVariablesClient serves a fixed number of pages of variables and
+// records how many requests it actually received, so tests can assert on
+// both correctness and how aggressively getVariables paginates.
+type pagedVariablesClient struct {
+	pageSize int
+	lastPage int
+	calls    int
+}
+
+func (c *pagedVariablesClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls++
+
+	page := 1
+	if p := req.URL.Query().Get("page"); p != "" {
+		var err error
+		page, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if page < 1 || page > c.lastPage {
+		return nil, fmt.Errorf("unexpected request for page %d", page)
+	}
+
+	count := c.pageSize
+	if page == c.lastPage {
+		count = c.pageSize / 2
+	}
+
+	var names []string
+	for i := 0; i < count; i++ {
+		names = append(names, fmt.Sprintf(`{"name":"VAR_%d_%d"}`, page, i))
+	}
+	body := fmt.Sprintf(`{"variables":[%s]}`, strings.Join(names, ","))
+
+	header := http.Header{}
+	header.Set("Link", fmt.Sprintf(
+		`<https://api.github.com/orgs/o/actions/variables?page=%d>; rel="next", <https://api.github.com/orgs/o/actions/variables?page=%d>; rel="last"`,
+		page+1, c.lastPage))
+
+	return &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     header,
+	}, nil
+}
+
+func TestGetVariables_FollowsAllPages(t *testing.T) {
+	client := &pagedVariablesClient{pageSize: 100, lastPage: 3}
+
+	variables, err := getVariables(client, "github.com", "orgs/o/actions/variables", 0)
+	require.NoError(t, err)
+
+	assert.Len(t, variables, 100+100+50)
+	assert.Equal(t, 3, client.calls)
+}
+
+func TestGetVariables_LimitStopsPaginationEarly(t *testing.T) {
+	client := &pagedVariablesClient{pageSize: 100, lastPage: 3}
+
+	variables, err := getVariables(client, "github.com", "orgs/o/actions/variables", 150)
+	require.NoError(t, err)
+
+	assert.Len(t, variables, 150)
+	// Pages 1 and 2 already cover the limit; page 3 should never be requested.
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestVariable_ExportData(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := &Variable{
+		Name:                 "REGION",
+		Value:                "us-east-1",
+		UpdatedAt:            updatedAt,
+		Visibility:           shared.Selected,
+		SelectedReposURL:     "https://api.github.com/orgs/o/actions/variables/REGION/repositories",
+		NumSelectedRepos:     2,
+		SelectedRepositories: []string{"o/a", "o/b"},
+	}
+
+	data := v.ExportData(variableFields)
+
+	assert.Equal(t, map[string]interface{}{
+		"name":                    "REGION",
+		"value":                   "us-east-1",
+		"updatedAt":               updatedAt,
+		"visibility":              shared.Selected,
+		"numSelectedRepos":        2,
+		"selectedRepositoriesUrl": v.SelectedReposURL,
+		"selectedRepositories":    []string{"o/a", "o/b"},
+	}, data)
+
+	// Only the requested fields should come back.
+	assert.Equal(t, map[string]interface{}{"name": "REGION"}, v.ExportData([]string{"name"}))
+}
+
+func TestResolveValue_SimpleHop(t *testing.T) {
+	values := map[string]string{
+		"A": "prefix-${{ vars.B }}-suffix",
+		"B": "middle",
+	}
+
+	resolved, unresolved, err := resolveValue("A", values)
+	require.NoError(t, err)
+	assert.Empty(t, unresolved)
+	assert.Equal(t, "prefix-middle-suffix", resolved)
+}
+
+// TestResolveValue_Diamond guards against a regression where a name
+// referenced from more than one place (directly, and via another variable)
+// was mistaken for a cycle even though there's no real back-reference.
+func TestResolveValue_Diamond(t *testing.T) {
+	values := map[string]string{
+		"A": "${{ vars.B }} ${{ vars.C }}",
+		"B": "b",
+		"C": "${{ vars.B }}",
+	}
+
+	resolved, unresolved, err := resolveValue("A", values)
+	require.NoError(t, err)
+	assert.Empty(t, unresolved)
+	assert.Equal(t, "b b", resolved)
+}
+
+func TestResolveValue_Cycle(t *testing.T) {
+	values := map[string]string{
+		"A": "${{ vars.B }}",
+		"B": "${{ vars.A }}",
+	}
+
+	_, _, err := resolveValue("A", values)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle detected")
+}
+
+func TestResolveValue_UnresolvedReference(t *testing.T) {
+	values := map[string]string{
+		"A": "${{ vars.MISSING }}",
+	}
+
+	resolved, unresolved, err := resolveValue("A", values)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"MISSING"}, unresolved)
+	assert.Equal(t, "${{ vars.MISSING }}", resolved)
+}
+
+func TestResolveValue_ExceedsMaxLength(t *testing.T) {
+	values := map[string]string{
+		"A": "${{ vars.B }}",
+		"B": strings.Repeat("x", maxResolvedValueLen+1),
+	}
+
+	_, _, err := resolveValue("A", values)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds")
+}
+
+func TestResolveVariableValues_ReportsUnresolvedReferences(t *testing.T) {
+	variables := []*Variable{
+		{Name: "A", Value: "${{ vars.MISSING }}"},
+	}
+	var errOut bytes.Buffer
+
+	resolveVariableValues(&errOut, variables)
+
+	assert.Equal(t, "${{ vars.MISSING }}", variables[0].Value)
+	assert.Contains(t, errOut.String(), "MISSING")
+}
+
+// fakeExporter stands in for the real cmdutil.Exporter produced by
+// AddJSONFlags, capturing whatever listRun hands it for inspection.
+type fakeExporter struct {
+	data interface{}
+}
+
+func (e *fakeExporter) Fields() []string { return variableFields }
+
+func (e *fakeExporter) Write(ios *iostreams.IOStreams, data interface{}) error {
+	e.data = data
+	return nil
+}
+
+// scriptedRoundTripper serves canned responses in order, regardless of the
+// request URL.
+type scriptedRoundTripper struct {
+	responses []string
+	calls     int
+}
+
+func (s *scriptedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s.calls >= len(s.responses) {
+		return nil, fmt.Errorf("unexpected request #%d: %s", s.calls+1, req.URL)
+	}
+	body := s.responses[s.calls]
+	s.calls++
+	return &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestListRun_JSONExport(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+
+	rt := &scriptedRoundTripper{responses: []string{
+		`{"variables":[{"name":"FOO","value":"bar"}]}`,
+	}}
+	exporter := &fakeExporter{}
+
+	opts := &ListOptions{
+		IO:         ios,
+		HttpClient: func() (*http.Client, error) { return &http.Client{Transport: rt}, nil },
+		BaseRepo:   func() (ghrepo.Interface, error) { return ghrepo.New("owner", "repo"), nil },
+		Exporter:   exporter,
+	}
+
+	err := listRun(opts)
+	require.NoError(t, err)
+
+	variables, ok := exporter.data.([]*Variable)
+	require.True(t, ok)
+	require.Len(t, variables, 1)
+	assert.Equal(t, "FOO", variables[0].Name)
+	assert.Equal(t, "bar", variables[0].Value)
+}
+
+func TestNewCmdList_FlagValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "org and env are mutually exclusive",
+			args:    []string{"--org", "o", "--env", "e"},
+			wantErr: "specify only one of `--org` or `--env`",
+		},
+		{
+			name:    "negative limit is rejected",
+			args:    []string{"--limit", "-1"},
+			wantErr: "invalid limit",
+		},
+		{
+			name:    "show-selected-repos requires org",
+			args:    []string{"--show-selected-repos"},
+			wantErr: "--show-selected-repos` is only supported with `--org`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ios, _, _, _ := iostreams.Test()
+			f := &cmdutil.Factory{IOStreams: ios}
+
+			cmd := NewCmdList(f, func(*ListOptions) error { return nil })
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+
+			_, err := cmd.ExecuteC()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// TestListRun_ShowSelectedRepos checks that an organization listing with
+// ShowSelectedRepos renders a "SELECTED REPOS" header alongside the
+// repository names fetched from each variable's SelectedReposURL.
+func TestListRun_ShowSelectedRepos(t *testing.T) {
+	ios, _, stdout, _ := iostreams.Test()
+	ios.SetStdoutTTY(true)
+
+	rt := &scriptedRoundTripper{responses: []string{
+		`{"variables":[{"name":"REGION","value":"us-east-1","visibility":"selected","selected_repositories_url":"https://api.github.com/orgs/my-org/actions/variables/REGION/repositories"}]}`,
+		`{"total_count":1,"repositories":[{"full_name":"my-org/service-a"}]}`,
+	}}
+
+	opts := &ListOptions{
+		IO:                ios,
+		HttpClient:        func() (*http.Client, error) { return &http.Client{Transport: rt}, nil },
+		Config:            func() (config.Config, error) { return config.NewBlankConfig(), nil },
+		OrgName:           "my-org",
+		ShowSelectedRepos: true,
+	}
+
+	err := listRun(opts)
+	require.NoError(t, err)
+
+	out := stdout.String()
+	assert.Contains(t, out, "SELECTED REPOS")
+	assert.Contains(t, out, "my-org/service-a")
+}